@@ -0,0 +1,183 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	router "github.com/gorilla/mux"
+)
+
+// stsRoleInfo is the admin-facing view of an stsRole; Policy is reported by
+// name rather than inlining the policy document itself. MaxSessionDuration
+// is carried in seconds, not time.Duration's default nanoseconds, so that a
+// PUT of e.g. "maxSessionDuration": 43200 means 12 hours as intended.
+type stsRoleInfo struct {
+	Name                   string         `json:"name"`
+	ID                     string         `json:"id"`
+	Arn                    string         `json:"arn"`
+	Policy                 string         `json:"policy"`
+	Trust                  stsTrustPolicy `json:"trust"`
+	MaxSessionDurationSecs int64          `json:"maxSessionDuration"`
+}
+
+// stsSessionInfo is the subset of an stsSession exposed over the admin API;
+// it deliberately omits the secret key and session token.
+type stsSessionInfo struct {
+	AccessKey   string    `json:"accessKey"`
+	ParentUser  string    `json:"parentUser"`
+	SessionName string    `json:"sessionName,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// registerAdminSTSRouter - registers the admin APIs used to inspect and
+// revoke active STS sessions and manage STS roles. Called from
+// registerAdminRouter.
+func registerAdminSTSRouter(mux *router.Router, adminVersion string) {
+	adminRouter := mux.NewRoute().PathPrefix("/").Subrouter()
+
+	adminRouter.Methods("GET").Path("/v" + adminVersion + "/sts/sessions").
+		HandlerFunc(listSTSSessionsHandler)
+	adminRouter.Methods("DELETE").Path("/v" + adminVersion + "/sts/sessions/{accessKey}").
+		HandlerFunc(revokeSTSSessionHandler)
+
+	adminRouter.Methods("GET").Path("/v" + adminVersion + "/sts/roles").
+		HandlerFunc(listSTSRolesHandler)
+	adminRouter.Methods("PUT").Path("/v" + adminVersion + "/sts/roles/{name}").
+		HandlerFunc(putSTSRoleHandler)
+	adminRouter.Methods("DELETE").Path("/v" + adminVersion + "/sts/roles/{name}").
+		HandlerFunc(deleteSTSRoleHandler)
+}
+
+// listSTSSessionsHandler - GET /minio/admin/v1/sts/sessions
+// Lists every STS session currently tracked by this node's credentials
+// store, including expired-but-not-yet-swept entries.
+func listSTSSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions := globalSTSCredentials.List()
+
+	infos := make([]stsSessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		infos = append(infos, stsSessionInfo{
+			AccessKey:   sess.Credential.AccessKey,
+			ParentUser:  sess.ParentUser,
+			SessionName: sess.SessionName,
+			Subject:     sess.Subject,
+			Expiry:      sess.Expiry,
+		})
+	}
+
+	data, err := json.Marshal(infos)
+	if err != nil {
+		writeErrorResponseJSON(w, toAdminAPIErrCode(err), r.URL)
+		return
+	}
+
+	writeSuccessResponseJSON(w, data)
+}
+
+// revokeSTSSessionHandler - DELETE /minio/admin/v1/sts/sessions/{accessKey}
+// Immediately revokes a single active STS session ahead of its natural
+// expiry, e.g. because the associated SAML/OIDC subject was deprovisioned.
+func revokeSTSSessionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := router.Vars(r)
+	accessKey := vars["accessKey"]
+
+	if _, ok := globalSTSCredentials.Get(accessKey); !ok {
+		writeErrorResponseJSON(w, ErrAdminNoSuchUser, r.URL)
+		return
+	}
+
+	if err := globalSTSCredentials.Revoke(newObjectLayerFn(), accessKey); err != nil {
+		writeErrorResponseJSON(w, toAdminAPIErrCode(err), r.URL)
+		return
+	}
+
+	writeSuccessResponseHeadersOnly(w)
+}
+
+// listSTSRolesHandler - GET /minio/admin/v1/sts/roles
+// Lists every role an admin has defined for SAML/OIDC principals to assume.
+func listSTSRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles := globalSTSRoles.List()
+
+	infos := make([]stsRoleInfo, 0, len(roles))
+	for _, role := range roles {
+		infos = append(infos, stsRoleInfo{
+			Name:                   role.Name,
+			ID:                     role.ID,
+			Arn:                    role.arn(),
+			Policy:                 role.Policy,
+			Trust:                  role.Trust,
+			MaxSessionDurationSecs: int64(role.MaxSessionDuration / time.Second),
+		})
+	}
+
+	data, err := json.Marshal(infos)
+	if err != nil {
+		writeErrorResponseJSON(w, toAdminAPIErrCode(err), r.URL)
+		return
+	}
+
+	writeSuccessResponseJSON(w, data)
+}
+
+// putSTSRoleHandler - PUT /minio/admin/v1/sts/roles/{name}
+// Defines (or replaces) a named role that SAML/OIDC principals matching its
+// trust policy may assume via AssumeRoleWithSAML/AssumeRoleWithWebIdentity.
+// The request body is an stsRoleInfo-shaped JSON document; Name and Arn are
+// taken from the path and ignored if also present in the body.
+func putSTSRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := router.Vars(r)["name"]
+
+	var info stsRoleInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		writeErrorResponseJSON(w, ErrAdminConfigBadJSON, r.URL)
+		return
+	}
+
+	role := &stsRole{
+		Name:               name,
+		ID:                 info.ID,
+		Policy:             info.Policy,
+		Trust:              info.Trust,
+		MaxSessionDuration: time.Duration(info.MaxSessionDurationSecs) * time.Second,
+	}
+
+	if err := globalSTSRoles.Register(newObjectLayerFn(), role); err != nil {
+		writeErrorResponseJSON(w, toAdminAPIErrCode(err), r.URL)
+		return
+	}
+
+	writeSuccessResponseHeadersOnly(w)
+}
+
+// deleteSTSRoleHandler - DELETE /minio/admin/v1/sts/roles/{name}
+// Removes a role definition so it can no longer be assumed. Credentials
+// already issued against it are unaffected; see globalSTSRoles.Delete.
+func deleteSTSRoleHandler(w http.ResponseWriter, r *http.Request) {
+	name := router.Vars(r)["name"]
+
+	if err := globalSTSRoles.Delete(newObjectLayerFn(), name); err != nil {
+		writeErrorResponseJSON(w, toAdminAPIErrCode(err), r.URL)
+		return
+	}
+
+	writeSuccessResponseHeadersOnly(w)
+}
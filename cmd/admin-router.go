@@ -0,0 +1,38 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	router "github.com/gorilla/mux"
+)
+
+const (
+	// adminPath is the fixed prefix every admin API is mounted under.
+	adminPath = "/minio/admin"
+
+	// adminAPIVersion is the version segment of the admin API path, e.g.
+	// /minio/admin/v1/...
+	adminAPIVersion = "1"
+)
+
+// registerAdminRouter - registers the admin APIs, mounted under
+// /minio/admin/.
+func registerAdminRouter(mux *router.Router) {
+	adminRouter := mux.NewRoute().PathPrefix(adminPath).Subrouter()
+
+	registerAdminSTSRouter(adminRouter, adminAPIVersion)
+}
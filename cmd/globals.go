@@ -0,0 +1,51 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+// ObjectLayer is the minimal backend surface the STS subsystem needs in
+// order to persist and read back its config-tree entries.
+type ObjectLayer interface {
+	GetObject(bucket, object string) ([]byte, error)
+	PutObject(bucket, object string, data []byte) error
+	DeleteObject(bucket, object string) error
+	ListObjects(bucket, prefix string) ([]string, error)
+}
+
+// globalObjectAPI is the server's initialized storage backend, set once by
+// setObjectLayer during startup.
+var globalObjectAPI ObjectLayer
+
+// newObjectLayerFn returns the currently initialized object layer, or nil
+// before the server has finished starting up.
+func newObjectLayerFn() ObjectLayer {
+	return globalObjectAPI
+}
+
+// setObjectLayer records the initialized object layer and brings up every
+// subsystem that depends on persistent storage being available. It is
+// called once, after the storage backend finishes initializing, by the
+// server startup sequence.
+func setObjectLayer(o ObjectLayer) {
+	globalObjectAPI = o
+
+	errorIf(loadSTSCredentialsStore(o), "Unable to load persisted STS sessions")
+	errorIf(loadSTSRoles(o), "Unable to load persisted STS role definitions")
+	errorIf(loadSAMLConfig(o), "Unable to load saml config")
+	errorIf(loadOpenIDConfig(o), "Unable to load identity_openid config")
+
+	go startSTSCredentialsSweeper(o)
+}
@@ -0,0 +1,427 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// samlConfigPath is where the "saml" config subsection is persisted in the
+// config/etcd layer.
+const samlConfigPath = "config/saml.json"
+
+// samlConfig carries the trust material needed to validate SAML 2.0
+// assertions locally instead of re-POSTing them back to the IdP.
+type samlConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// MetadataURL points at the IdP's SAML metadata document, from which
+	// its signing certificate(s) are loaded.
+	MetadataURL string `json:"metadataURL"`
+
+	// EntityID is this deployment's SP entity ID, matched against the
+	// assertion's AudienceRestriction.
+	EntityID string `json:"entityID"`
+
+	// ClockSkew is the tolerance applied around NotBefore/NotOnOrAfter to
+	// absorb clock drift between this server and the IdP.
+	ClockSkew time.Duration `json:"clockSkew"`
+}
+
+// globalSAMLConfig holds the currently configured IdP trust relationship,
+// seeded from the "saml" config subsection at startup.
+var globalSAMLConfig samlConfig
+
+// globalSAMLIDPStore caches the IdP's signing certificates fetched from
+// globalSAMLConfig.MetadataURL.
+var globalSAMLIDPStore = &samlIDPStore{}
+
+type samlIDPStore struct {
+	mu          sync.RWMutex
+	metadataURL string
+	certStore   dsig.X509CertificateStore
+}
+
+// certificateStore returns a dsig.X509CertificateStore built from the
+// cached IdP metadata, refetching the metadata document if it hasn't been
+// loaded yet or the configured URL changed.
+func (s *samlIDPStore) certificateStore() (dsig.X509CertificateStore, error) {
+	s.mu.RLock()
+	if s.metadataURL == globalSAMLConfig.MetadataURL && s.certStore != nil {
+		store := s.certStore
+		s.mu.RUnlock()
+		return store, nil
+	}
+	s.mu.RUnlock()
+
+	resp, err := http.Get(globalSAMLConfig.MetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	metadata, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := parseIDPSigningCertificates(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &dsig.MemoryX509CertificateStore{Roots: certs}
+
+	s.mu.Lock()
+	s.metadataURL = globalSAMLConfig.MetadataURL
+	s.certStore = store
+	s.mu.Unlock()
+
+	return store, nil
+}
+
+// idpSSODescriptorMetadata is the subset of a SAML 2.0 IdP metadata document
+// (urn:oasis:names:tc:SAML:2.0:metadata) needed to extract its signing
+// certificate(s). goxmldsig has no metadata parser of its own, so this
+// mirrors only the handful of elements MinIO cares about.
+type idpSSODescriptorMetadata struct {
+	IDPSSODescriptor struct {
+		KeyDescriptor []struct {
+			Use     string `xml:"use,attr"`
+			KeyInfo struct {
+				X509Data struct {
+					X509Certificate string `xml:"X509Certificate"`
+				} `xml:"X509Data"`
+			} `xml:"KeyInfo"`
+		} `xml:"KeyDescriptor"`
+	} `xml:"IDPSSODescriptor"`
+}
+
+// parseIDPSigningCertificates extracts every certificate from metadata's
+// signing KeyDescriptor elements (or undeclared-use ones, which signing
+// defaults to per the spec).
+func parseIDPSigningCertificates(metadata []byte) ([]*x509.Certificate, error) {
+	var doc idpSSODescriptorMetadata
+	if err := xml.Unmarshal(metadata, &doc); err != nil {
+		return nil, fmt.Errorf("saml: unable to parse IdP metadata: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for _, kd := range doc.IDPSSODescriptor.KeyDescriptor {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+
+		der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(kd.KeyInfo.X509Data.X509Certificate))
+		if err != nil {
+			return nil, fmt.Errorf("saml: invalid certificate in IdP metadata: %w", err)
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("saml: invalid certificate in IdP metadata: %w", err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("saml: IdP metadata contains no signing certificates")
+	}
+
+	return certs, nil
+}
+
+// samlReplayCache remembers the InResponseTo value of every assertion we've
+// accepted, rejecting a second assertion carrying the same value until it
+// ages out past its own NotOnOrAfter.
+type samlReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+var globalSAMLReplayCache = &samlReplayCache{seen: make(map[string]time.Time)}
+
+// checkAndRemember returns an error if id has already been used, and
+// otherwise records it until expiry.
+func (c *samlReplayCache) checkAndRemember(id string, expiry time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for seenID, seenExpiry := range c.seen {
+		if UTCNow().After(seenExpiry) {
+			delete(c.seen, seenID)
+		}
+	}
+
+	if _, ok := c.seen[id]; ok {
+		return fmt.Errorf("saml: assertion with InResponseTo %q has already been used", id)
+	}
+
+	c.seen[id] = expiry
+	return nil
+}
+
+// nameID - the saml:NameID element of a Subject.
+type nameID struct {
+	Format string `xml:"Format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type subjectConfirmationData struct {
+	Recipient    string `xml:"Recipient,attr"`
+	NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+	InResponseTo string `xml:"InResponseTo,attr"`
+}
+
+type subjectConfirmation struct {
+	SubjectConfirmationData subjectConfirmationData `xml:"SubjectConfirmationData"`
+}
+
+type samlSubject struct {
+	NameID              nameID              `xml:"NameID"`
+	SubjectConfirmation subjectConfirmation `xml:"SubjectConfirmation"`
+}
+
+type audienceRestriction struct {
+	Audience string `xml:"Audience"`
+}
+
+type samlConditions struct {
+	NotBefore           string              `xml:"NotBefore,attr"`
+	NotOnOrAfter        string              `xml:"NotOnOrAfter,attr"`
+	AudienceRestriction audienceRestriction `xml:"AudienceRestriction"`
+}
+
+type authnStatement struct {
+	SessionNotOnOrAfter string `xml:"SessionNotOnOrAfter,attr"`
+}
+
+type samlAssertion struct {
+	Subject        samlSubject    `xml:"Subject"`
+	Conditions     samlConditions `xml:"Conditions"`
+	AuthnStatement authnStatement `xml:"AuthnStatement"`
+}
+
+type samlIssuer struct {
+	URL string `xml:",chardata"`
+}
+
+// SAMLResponse is the parsed form of a SAMLAssertion form value posted to
+// AssumeRoleWithSAML. Destination/InResponseTo/Issuer/Assertion are
+// populated from the outer, not-yet-trusted document by ParseSAMLResponse;
+// validateSAMLAssertion re-populates Assertion from the signature-verified
+// element before any of its fields are trusted.
+type SAMLResponse struct {
+	XMLName      xml.Name      `xml:"Response"`
+	Destination  string        `xml:"Destination,attr"`
+	InResponseTo string        `xml:"InResponseTo,attr"`
+	Issuer       samlIssuer    `xml:"Issuer"`
+	Assertion    samlAssertion `xml:"Assertion"`
+
+	// root is the parsed XML tree the signature is verified against, kept
+	// around so validateSAMLAssertion can locate and validate the
+	// Assertion element itself rather than a re-serialized copy.
+	root *etree.Element
+}
+
+// ParseSAMLResponse base64-decodes and parses a SAMLResponse XML document.
+// It does not, by itself, establish trust in the document's contents;
+// callers must call validateSAMLAssertion afterwards, and must not act on
+// any field read before that call succeeds.
+func ParseSAMLResponse(encoded string) (*SAMLResponse, error) {
+	if encoded == "" {
+		return nil, errors.New("saml: SAMLAssertion is missing")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	if err = doc.ReadFromBytes(raw); err != nil {
+		return nil, fmt.Errorf("saml: unable to parse response XML: %w", err)
+	}
+	if doc.Root() == nil {
+		return nil, errors.New("saml: response is missing a root element")
+	}
+
+	var resp SAMLResponse
+	if err = xml.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
+	resp.root = doc.Root()
+
+	return &resp, nil
+}
+
+// validateSAMLAssertion performs full SAML 2.0 assertion validation: the
+// XML-DSig signature against the configured IdP's certificate(s), the
+// validity window, the audience restriction, the intended destination and
+// recipient, and replay protection on InResponseTo. acsURL is this
+// deployment's assertion consumer service URL, i.e. the STS endpoint the
+// assertion must have been addressed to.
+func validateSAMLAssertion(resp *SAMLResponse, acsURL string) error {
+	if !globalSAMLConfig.Enabled {
+		return errors.New("saml: SAML federation is not configured")
+	}
+
+	certStore, err := globalSAMLIDPStore.certificateStore()
+	if err != nil {
+		return err
+	}
+
+	assertionEl := resp.root.FindElement("./Assertion")
+	if assertionEl == nil {
+		return errors.New("saml: response is missing an Assertion element")
+	}
+
+	validationCtx := dsig.NewDefaultValidationContext(certStore)
+	verifiedAssertionEl, err := validationCtx.Validate(assertionEl)
+	if err != nil {
+		return fmt.Errorf("saml: signature validation failed: %w", err)
+	}
+
+	// Re-derive the assertion's claims from the element the signature was
+	// actually verified against, discarding whatever resp.Assertion was
+	// unmarshaled from by ParseSAMLResponse. Trusting the outer document
+	// instead would allow an XML-signature-wrapping attack: a validly
+	// signed assertion pasted inside a forged envelope carrying different
+	// claims at the same XPath.
+	verifiedAssertionXML, err := elementToBytes(verifiedAssertionEl)
+	if err != nil {
+		return err
+	}
+	var assertion samlAssertion
+	if err = xml.Unmarshal(verifiedAssertionXML, &assertion); err != nil {
+		return fmt.Errorf("saml: unable to parse verified assertion: %w", err)
+	}
+	resp.Assertion = assertion
+
+	now := UTCNow()
+	skew := globalSAMLConfig.ClockSkew
+
+	if notBefore := resp.Assertion.Conditions.NotBefore; notBefore != "" {
+		t, perr := time.Parse(time.RFC3339, notBefore)
+		if perr != nil {
+			return fmt.Errorf("saml: invalid NotBefore: %w", perr)
+		}
+		if now.Add(skew).Before(t) {
+			return errors.New("saml: assertion is not yet valid (NotBefore)")
+		}
+	}
+
+	notOnOrAfter := resp.Assertion.Conditions.NotOnOrAfter
+	if notOnOrAfter == "" {
+		return errors.New("saml: assertion is missing Conditions/NotOnOrAfter")
+	}
+	conditionsExpiry, err := time.Parse(time.RFC3339, notOnOrAfter)
+	if err != nil {
+		return fmt.Errorf("saml: invalid NotOnOrAfter: %w", err)
+	}
+	if now.Add(-skew).After(conditionsExpiry) {
+		return errors.New("saml: assertion has expired (NotOnOrAfter)")
+	}
+
+	if resp.Assertion.Conditions.AudienceRestriction.Audience != globalSAMLConfig.EntityID {
+		return fmt.Errorf("saml: unexpected audience %q", resp.Assertion.Conditions.AudienceRestriction.Audience)
+	}
+
+	if resp.Destination != acsURL {
+		return fmt.Errorf("saml: unexpected Destination %q", resp.Destination)
+	}
+
+	confirmation := resp.Assertion.Subject.SubjectConfirmation.SubjectConfirmationData
+	if confirmation.Recipient != acsURL {
+		return fmt.Errorf("saml: unexpected Recipient %q", confirmation.Recipient)
+	}
+
+	confirmationExpiry, err := time.Parse(time.RFC3339, confirmation.NotOnOrAfter)
+	if err != nil {
+		return fmt.Errorf("saml: invalid SubjectConfirmationData/NotOnOrAfter: %w", err)
+	}
+	if now.Add(-skew).After(confirmationExpiry) {
+		return errors.New("saml: subject confirmation has expired")
+	}
+
+	if confirmation.InResponseTo == "" {
+		return errors.New("saml: assertion is missing InResponseTo")
+	}
+	if err = globalSAMLReplayCache.checkAndRemember(confirmation.InResponseTo, conditionsExpiry); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loadSAMLConfig reads the "saml" config subsection from the config/etcd
+// layer and seeds globalSAMLConfig from it, so that validateSAMLAssertion
+// has trust material to validate against. Absent config leaves
+// globalSAMLConfig at its zero value, i.e. disabled.
+func loadSAMLConfig(objAPI ObjectLayer) error {
+	data, err := readConfig(objAPI, samlConfigPath)
+	if err != nil {
+		if err == errConfigNotFound {
+			return nil
+		}
+		return err
+	}
+
+	var cfg samlConfig
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	globalSAMLConfig = cfg
+	return nil
+}
+
+// elementToBytes serializes el back to XML, isolated from the rest of the
+// document it was parsed from.
+func elementToBytes(el *etree.Element) ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.SetRoot(el.Copy())
+	return doc.WriteToBytes()
+}
+
+// samlCredentialExpiry returns the upper bound DurationSeconds must be
+// clamped to: the SAML AuthnStatement's SessionNotOnOrAfter, if present,
+// otherwise a zero Time meaning no additional bound applies.
+func samlCredentialExpiry(resp *SAMLResponse) (time.Time, bool) {
+	if resp.Assertion.AuthnStatement.SessionNotOnOrAfter == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, resp.Assertion.AuthnStatement.SessionNotOnOrAfter)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
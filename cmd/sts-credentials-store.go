@@ -0,0 +1,225 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+)
+
+// stsSessionConfigPrefix is the config-tree prefix under which issued STS
+// sessions are persisted, mirroring how the IAM subsystem lays out
+// config/iam/ so that entries survive restarts and replicate across a
+// distributed cluster via the same config/etcd layer.
+const stsSessionConfigPrefix = "config/iam/sts/"
+
+// stsSweepInterval is how often expired sessions are evicted from the store.
+const stsSweepInterval = 5 * time.Minute
+
+// stsSession is a single issued temporary credential together with the
+// context it was minted under.
+type stsSession struct {
+	Credential  credential `json:"credential"`
+	ParentUser  string     `json:"parentUser"`
+	SessionName string     `json:"sessionName"`
+	// Subject is the SAML NameID or OIDC "sub" claim the credential was
+	// federated from, empty for AssumeRole/GetSessionToken/GetFederationToken.
+	Subject string `json:"subject,omitempty"`
+	// RolePolicy is the name of the IAM policy attached to the role this
+	// session assumed, set only for AssumeRoleWithSAML/WithWebIdentity
+	// sessions. Those sessions have no corresponding IAM user behind
+	// ParentUser to look permissions up for, so stsSessionIsAllowed
+	// evaluates this policy directly instead.
+	RolePolicy string    `json:"rolePolicy,omitempty"`
+	Policy     string    `json:"policy,omitempty"`
+	Expiry     time.Time `json:"expiry"`
+}
+
+func (s stsSession) expired() bool {
+	return UTCNow().After(s.Expiry)
+}
+
+// stsCredentialsStore persists issued temporary credentials keyed by access
+// key. It replaces directly overwriting globalServerCreds on every STS
+// call, which previously clobbered the server's root credentials and broke
+// every other signed-in client.
+type stsCredentialsStore struct {
+	mu       sync.RWMutex
+	sessions map[string]stsSession
+}
+
+// globalSTSCredentials is the process-wide store consulted by S3 request
+// signature validation before falling back to globalServerCreds.
+var globalSTSCredentials = newSTSCredentialsStore()
+
+func newSTSCredentialsStore() *stsCredentialsStore {
+	return &stsCredentialsStore{
+		sessions: make(map[string]stsSession),
+	}
+}
+
+// Put records a newly minted session and persists it to the config/etcd
+// layer so it survives a restart and is visible to every node in the
+// cluster.
+func (s *stsCredentialsStore) Put(objAPI ObjectLayer, sess stsSession) error {
+	s.mu.Lock()
+	s.sessions[sess.Credential.AccessKey] = sess
+	s.mu.Unlock()
+
+	return s.persist(objAPI, sess)
+}
+
+// Get looks up a session by access key, returning false if it is unknown or
+// has expired.
+func (s *stsCredentialsStore) Get(accessKey string) (stsSession, bool) {
+	s.mu.RLock()
+	sess, ok := s.sessions[accessKey]
+	s.mu.RUnlock()
+	if !ok || sess.expired() {
+		return stsSession{}, false
+	}
+	return sess, true
+}
+
+// List returns every currently tracked session, expired or not, for admin
+// inspection.
+func (s *stsCredentialsStore) List() []stsSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]stsSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// Revoke removes a session immediately, e.g. in response to an admin
+// request, rather than waiting for it to expire naturally.
+func (s *stsCredentialsStore) Revoke(objAPI ObjectLayer, accessKey string) error {
+	s.mu.Lock()
+	delete(s.sessions, accessKey)
+	s.mu.Unlock()
+
+	return s.deletePersisted(objAPI, accessKey)
+}
+
+func (s *stsCredentialsStore) configPath(accessKey string) string {
+	return path.Join(stsSessionConfigPrefix, accessKey+".json")
+}
+
+func (s *stsCredentialsStore) persist(objAPI ObjectLayer, sess stsSession) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	if objAPI != nil {
+		if err = saveConfig(objAPI, s.configPath(sess.Credential.AccessKey), data); err != nil {
+			return err
+		}
+	}
+
+	if globalEtcdClient != nil {
+		return saveConfigEtcd(globalEtcdClient, s.configPath(sess.Credential.AccessKey), data)
+	}
+
+	return nil
+}
+
+func (s *stsCredentialsStore) deletePersisted(objAPI ObjectLayer, accessKey string) error {
+	if objAPI != nil {
+		if err := deleteConfig(objAPI, s.configPath(accessKey)); err != nil && err != errConfigNotFound {
+			return err
+		}
+	}
+
+	if globalEtcdClient != nil {
+		return deleteConfigEtcd(globalEtcdClient, s.configPath(accessKey))
+	}
+
+	return nil
+}
+
+// stsCredentialForAccessKey is consulted by the S3 request signature
+// validator ahead of globalServerCreds: an access key minted by any STS
+// action is only ever found here, never in the root credentials, so
+// request signing must check the session store first and only then compare
+// against globalServerCreds.AccessKey for the server's own root
+// credentials.
+func stsCredentialForAccessKey(accessKey string) (credential, bool) {
+	sess, ok := globalSTSCredentials.Get(accessKey)
+	if !ok {
+		return credential{}, false
+	}
+	return sess.Credential, true
+}
+
+// loadSTSCredentialsStore reads back every persisted session under
+// config/iam/sts/ on startup, so that restarting a node (or the other
+// members of a distributed cluster) keeps honoring credentials minted
+// before the restart.
+func loadSTSCredentialsStore(objAPI ObjectLayer) error {
+	entries, err := listConfig(objAPI, stsSessionConfigPrefix)
+	if err != nil {
+		if err == errConfigNotFound {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		data, rerr := readConfig(objAPI, entry)
+		if rerr != nil {
+			continue
+		}
+
+		var sess stsSession
+		if jerr := json.Unmarshal(data, &sess); jerr != nil {
+			continue
+		}
+
+		if sess.expired() {
+			continue
+		}
+
+		globalSTSCredentials.mu.Lock()
+		globalSTSCredentials.sessions[sess.Credential.AccessKey] = sess
+		globalSTSCredentials.mu.Unlock()
+	}
+
+	return nil
+}
+
+// startSTSCredentialsSweeper runs for the lifetime of the server, evicting
+// expired sessions from memory and from the config/etcd layer so the store
+// doesn't grow without bound.
+func startSTSCredentialsSweeper(objAPI ObjectLayer) {
+	ticker := time.NewTicker(stsSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, sess := range globalSTSCredentials.List() {
+			if sess.expired() {
+				errorIf(globalSTSCredentials.Revoke(objAPI, sess.Credential.AccessKey),
+					"Unable to evict expired STS session for %s", sess.Credential.AccessKey)
+			}
+		}
+	}
+}
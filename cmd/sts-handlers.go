@@ -18,13 +18,11 @@ package cmd
 
 import (
 	"crypto/sha1"
-	"crypto/tls"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
-	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"time"
 
@@ -34,8 +32,71 @@ import (
 const (
 	// STS API version.
 	stsAPIVersion = "2011-06-15"
+
+	// Default, minimum and maximum allowed values (in seconds) for the
+	// DurationSeconds request parameter, matching the AWS STS API.
+	stsDefaultDurationSecs = 3600
+	stsMinDurationSecs     = 900
+	stsMaxDurationSecs     = 12 * 60 * 60
+
+	// stsMaxPolicySize is the maximum allowed packed size, in bytes, of an
+	// inline session policy document.
+	stsMaxPolicySize = 2048
 )
 
+// packedPolicySize returns the percentage (0-100+) that policy occupies of
+// the maximum allowed packed policy size, as reported back to the caller in
+// the PackedPolicySize response field.
+func packedPolicySize(policy string) int64 {
+	if policy == "" {
+		return 0
+	}
+	return int64(len(policy)) * 100 / stsMaxPolicySize
+}
+
+// stsDurationFromForm parses the optional DurationSeconds form value,
+// clamping it to [min, max] seconds, and returns the resulting expiry
+// timestamp. If DurationSeconds is absent, def is used instead.
+func stsDurationFromForm(r *http.Request, def, min, max int64) (time.Time, error) {
+	if r.Form.Get("DurationSeconds") == "" {
+		return UTCNow().Add(time.Duration(def) * time.Second), nil
+	}
+
+	expirySecs, err := strconv.ParseInt(r.Form.Get("DurationSeconds"), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if expirySecs < min {
+		expirySecs = min
+	}
+	if expirySecs > max {
+		expirySecs = max
+	}
+
+	return UTCNow().Add(time.Duration(expirySecs) * time.Second), nil
+}
+
+// registerSessionPolicy persists the inline policy, governing role policy
+// and parent user associated with a newly minted session access key in the
+// stsCredentialsStore, so that S3 request signing can later evaluate it as
+// the intersection of the governing identity's permissions and this session
+// policy, and so the session survives restarts and is visible
+// cluster-wide. rolePolicy is empty except for AssumeRoleWithSAML/
+// WithWebIdentity, whose sessions are scoped to the assumed role's policy
+// rather than a real IAM user's.
+func registerSessionPolicy(cred credential, parentUser, sessionName, subject, policy, rolePolicy string, expiry time.Time) {
+	errorIf(globalSTSCredentials.Put(newObjectLayerFn(), stsSession{
+		Credential:  cred,
+		ParentUser:  parentUser,
+		SessionName: sessionName,
+		Subject:     subject,
+		RolePolicy:  rolePolicy,
+		Policy:      policy,
+		Expiry:      expiry,
+	}), "Unable to persist STS session for %s", cred.AccessKey)
+}
+
 // stsAPIHandlers implements and provides http handlers for AWS STS API.
 type stsAPIHandlers struct{}
 
@@ -47,8 +108,255 @@ func registerSTSRouter(mux *router.Router) {
 	// STS Router
 	stsRouter := mux.NewRoute().PathPrefix("/").Subrouter()
 
-	// AssumeRoleWithSAML
-	stsRouter.Methods("POST").HandlerFunc(sts.AssumeRoleWithSAMLHandler)
+	// All STS operations are dispatched off of a single POST route by the
+	// "Action" form field, mirroring the AWS STS API.
+	stsRouter.Methods("POST").HandlerFunc(sts.ServeSTS)
+}
+
+// ServeSTS is the single entry point for every STS operation. It parses the
+// request form once and dispatches to the handler named by the "Action"
+// parameter.
+func (sts *stsAPIHandlers) ServeSTS(w http.ResponseWriter, r *http.Request) {
+	// No authentication happens here; the handlers for AssumeRole,
+	// GetSessionToken and GetFederationToken verify the SigV4 signature
+	// themselves.
+	if err := r.ParseForm(); err != nil {
+		errorIf(err, "Unable to parse incoming data.")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	switch r.Form.Get("Action") {
+	case "AssumeRole":
+		sts.AssumeRoleHandler(w, r)
+	case "AssumeRoleWithSAML":
+		sts.AssumeRoleWithSAMLHandler(w, r)
+	case "AssumeRoleWithWebIdentity":
+		sts.AssumeRoleWithWebIdentityHandler(w, r)
+	case "GetSessionToken":
+		sts.GetSessionTokenHandler(w, r)
+	case "GetFederationToken":
+		sts.GetFederationTokenHandler(w, r)
+	default:
+		errorIf(fmt.Errorf("unknown STS action %q", r.Form.Get("Action")), "")
+		writeSTSErrorResponse(w, ErrSTSInvalidParameterValue)
+	}
+}
+
+// stsSAMLAssertionConsumerURL reconstructs the URL this STS endpoint was
+// reached on, which must match the assertion's Destination and the
+// SubjectConfirmationData Recipient for AssumeRoleWithSAML to succeed.
+func stsSAMLAssertionConsumerURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// errSTSDurationExceedsRoleMax is returned by stsSAMLSessionExpiry when the
+// caller's requested DurationSeconds is greater than the assumed role's
+// MaxSessionDuration.
+var errSTSDurationExceedsRoleMax = errors.New("requested DurationSeconds exceeds the role's MaxSessionDuration")
+
+// stsSAMLSessionExpiry computes the expiry of a credential minted for role,
+// honoring DurationSeconds up to role's MaxSessionDuration (returning
+// errSTSDurationExceedsRoleMax if it is exceeded, rather than silently
+// clamping, matching AWS's validation behavior) and then clamping the
+// result to the SAML assertion's own SessionNotOnOrAfter, if present.
+func stsSAMLSessionExpiry(r *http.Request, role *stsRole, samlResp *SAMLResponse) (time.Time, error) {
+	requestedSecs := int64(stsDefaultDurationSecs)
+	if v := r.PostForm.Get("DurationSeconds"); v != "" {
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		requestedSecs = secs
+	}
+
+	if requestedSecs < stsMinDurationSecs {
+		requestedSecs = stsMinDurationSecs
+	}
+
+	if time.Duration(requestedSecs)*time.Second > role.maxSessionDuration() {
+		return time.Time{}, errSTSDurationExceedsRoleMax
+	}
+
+	expiry := UTCNow().Add(time.Duration(requestedSecs) * time.Second)
+
+	// SessionNotOnOrAfter, if present in the assertion, is an upper bound
+	// on the returned credential expiry regardless of what was requested.
+	if sessionExpiry, ok := samlCredentialExpiry(samlResp); ok && sessionExpiry.Before(expiry) {
+		expiry = sessionExpiry
+	}
+
+	return expiry, nil
+}
+
+// stsRequestorAccessKey validates the SigV4 signature carried on the
+// incoming request and returns the access key of the already-authenticated
+// parent user requesting the session. AssumeRole and GetFederationToken, per
+// the AWS STS API, are only ever called by a principal that is already
+// signed in; unlike AssumeRoleWithSAML/WithWebIdentity there is no external
+// assertion to bootstrap trust from.
+func stsRequestorAccessKey(r *http.Request) (accessKey string, apiErr APIErrorCode) {
+	cred, _, s3Err := getReqAccessKeyV4(r, globalServerRegion)
+	if s3Err != ErrNone {
+		return "", ErrSTSAccessDenied
+	}
+	return cred.AccessKey, ErrNone
+}
+
+// AssumeRoleResult - Contains the response to a successful AssumeRole
+// request, including temporary credentials that can be used to make AWS
+// requests.
+// Please also see https://docs.aws.amazon.com/goto/WebAPI/sts-2011-06-15/AssumeRoleResponse
+type AssumeRoleResult struct {
+	AssumedRoleUser  AssumedRoleUser `xml:",omitempty"`
+	Credentials      credential      `xml:",omitempty"`
+	PackedPolicySize int64           `xml:",omitempty"`
+}
+
+func (sts *stsAPIHandlers) AssumeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	parentUser, apiErr := stsRequestorAccessKey(r)
+	if apiErr != ErrNone {
+		writeSTSErrorResponse(w, apiErr)
+		return
+	}
+
+	policy := r.Form.Get("Policy")
+	if len(policy) > stsMaxPolicySize {
+		writeSTSErrorResponse(w, ErrSTSPackedPolicyTooLarge)
+		return
+	}
+
+	expiryTime, err := stsDurationFromForm(r, stsDefaultDurationSecs, stsMinDurationSecs, stsMaxDurationSecs)
+	if err != nil {
+		errorIf(err, "Unable to parse DurationSeconds")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	cred, err := getNewCredentialWithExpiry(expiryTime)
+	if err != nil {
+		errorIf(err, "Failed to generate new credentials with expiry.")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	// Persist the inline policy alongside the minted access key so that
+	// S3 request signing can evaluate it as the intersection of the
+	// parent user's permissions and this session policy.
+	registerSessionPolicy(cred, parentUser, r.Form.Get("RoleSessionName"), "", policy, "", expiryTime)
+
+	assumeRoleOutput := &AssumeRoleResult{
+		Credentials:      cred,
+		PackedPolicySize: packedPolicySize(policy),
+	}
+
+	encodedSuccessResponse := encodeResponse(assumeRoleOutput)
+	writeSuccessResponseXML(w, encodedSuccessResponse)
+}
+
+// GetSessionTokenResult - Contains the response to a successful
+// GetSessionToken request, including temporary credentials that can be used
+// to make AWS requests.
+// Please also see https://docs.aws.amazon.com/goto/WebAPI/sts-2011-06-15/GetSessionTokenResponse
+type GetSessionTokenResult struct {
+	Credentials credential `xml:",omitempty"`
+}
+
+func (sts *stsAPIHandlers) GetSessionTokenHandler(w http.ResponseWriter, r *http.Request) {
+	parentUser, apiErr := stsRequestorAccessKey(r)
+	if apiErr != ErrNone {
+		writeSTSErrorResponse(w, apiErr)
+		return
+	}
+
+	expiryTime, err := stsDurationFromForm(r, stsDefaultDurationSecs, stsMinDurationSecs, stsMaxDurationSecs)
+	if err != nil {
+		errorIf(err, "Unable to parse DurationSeconds")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	cred, err := getNewCredentialWithExpiry(expiryTime)
+	if err != nil {
+		errorIf(err, "Failed to generate new credentials with expiry.")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	// GetSessionToken never carries an inline policy: the session simply
+	// inherits the parent user's own permissions.
+	registerSessionPolicy(cred, parentUser, "", "", "", "", expiryTime)
+
+	sessionTokenOutput := &GetSessionTokenResult{
+		Credentials: cred,
+	}
+
+	encodedSuccessResponse := encodeResponse(sessionTokenOutput)
+	writeSuccessResponseXML(w, encodedSuccessResponse)
+}
+
+// FederatedUser - Identifiers for the federated user associated with the
+// credentials.
+type FederatedUser struct {
+	Arn             string
+	FederatedUserID string `xml:"FederatedUserId"`
+}
+
+// GetFederationTokenResult - Contains the response to a successful
+// GetFederationToken request, including temporary credentials that can be
+// used to make AWS requests.
+// Please also see https://docs.aws.amazon.com/goto/WebAPI/sts-2011-06-15/GetFederationTokenResponse
+type GetFederationTokenResult struct {
+	Credentials      credential    `xml:",omitempty"`
+	FederatedUser    FederatedUser `xml:",omitempty"`
+	PackedPolicySize int64         `xml:",omitempty"`
+}
+
+func (sts *stsAPIHandlers) GetFederationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	parentUser, apiErr := stsRequestorAccessKey(r)
+	if apiErr != ErrNone {
+		writeSTSErrorResponse(w, apiErr)
+		return
+	}
+
+	policy := r.Form.Get("Policy")
+	if len(policy) > stsMaxPolicySize {
+		writeSTSErrorResponse(w, ErrSTSPackedPolicyTooLarge)
+		return
+	}
+
+	// GetFederationToken's DurationSeconds ranges 900-129600 seconds (15
+	// minutes to 36 hours) per the AWS API, rather than the 12 hour cap
+	// that applies to AssumeRole.
+	const stsFederationMaxDurationSecs = 129600
+	expiryTime, err := stsDurationFromForm(r, stsDefaultDurationSecs, stsMinDurationSecs, stsFederationMaxDurationSecs)
+	if err != nil {
+		errorIf(err, "Unable to parse DurationSeconds")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	cred, err := getNewCredentialWithExpiry(expiryTime)
+	if err != nil {
+		errorIf(err, "Failed to generate new credentials with expiry.")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	registerSessionPolicy(cred, parentUser, r.Form.Get("Name"), "", policy, "", expiryTime)
+
+	federationTokenOutput := &GetFederationTokenResult{
+		Credentials:      cred,
+		FederatedUser:    FederatedUser{FederatedUserID: cred.AccessKey},
+		PackedPolicySize: packedPolicySize(policy),
+	}
+
+	encodedSuccessResponse := encodeResponse(federationTokenOutput)
+	writeSuccessResponseXML(w, encodedSuccessResponse)
 }
 
 // AssumedRoleUser - The identifiers for the temporary security credentials that
@@ -125,7 +433,35 @@ type AssumeRoleWithSAMLResult struct {
 	SubjectType string `xml:",omitempty"`
 }
 
-func (sts *stsAPIHandlers) AssumeRoleWithSAMLHandler(w http.ResponseWriter, r *http.Request) {
+// AssumeRoleWithWebIdentityResult - Contains the response to a successful
+// AssumeRoleWithWebIdentity request, including temporary credentials that can
+// be used to make AWS requests.
+// Please also see https://docs.aws.amazon.com/goto/WebAPI/sts-2011-06-15/AssumeRoleWithWebIdentityResponse
+type AssumeRoleWithWebIdentityResult struct {
+	// The identifiers for the temporary security credentials that the operation
+	// returns.
+	AssumedRoleUser AssumedRoleUser `xml:",omitempty"`
+
+	// The intended audience (target resource or client ID) of the web identity
+	// token. This is traditionally the client ID of the application.
+	Audience string `xml:",omitempty"`
+
+	// The temporary security credentials, which include an access key ID, a
+	// secret access key, and a security (or session) token.
+	Credentials credential `xml:",omitempty"`
+
+	// A percentage value that indicates the size of the policy in packed form.
+	PackedPolicySize int64 `xml:",omitempty"`
+
+	// The issuing authority of the web identity token presented. For OpenID
+	// Connect ID tokens, this contains the value of the iss field.
+	Provider string `xml:",omitempty"`
+
+	// The unique user identifier that is returned by the identity provider.
+	SubjectFromWebIdentityToken string `xml:",omitempty"`
+}
+
+func (sts *stsAPIHandlers) AssumeRoleWithWebIdentityHandler(w http.ResponseWriter, r *http.Request) {
 	// This is an unauthenticated request.
 	if err := r.ParseForm(); err != nil {
 		errorIf(err, "Unable to parse incoming data.")
@@ -139,71 +475,140 @@ func (sts *stsAPIHandlers) AssumeRoleWithSAMLHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	samlResp, err := ParseSAMLResponse(r.PostForm.Get("SAMLAssertion"))
+	token := r.PostForm.Get("WebIdentityToken")
+	if token == "" {
+		errorIf(errors.New("WebIdentityToken is missing"), "")
+		writeSTSErrorResponse(w, ErrSTSMissingParameter)
+		return
+	}
+
+	claims, err := validateWebIdentityJWT(token)
 	if err != nil {
-		errorIf(err, "Unable to parse saml assertion.")
+		errorIf(err, "Unable to validate web identity token.")
+		writeSTSErrorResponse(w, ErrSTSInvalidIdentityToken)
+		return
+	}
+
+	role, ok := globalSTSRoles.Lookup(r.PostForm.Get("RoleArn"))
+	if !ok {
+		errorIf(fmt.Errorf("no such role %q", r.PostForm.Get("RoleArn")), "")
+		writeSTSErrorResponse(w, ErrSTSInvalidParameterValue)
+		return
+	}
+
+	if !role.Trust.allowsOIDC(claims.Issuer, claims.Subject) {
+		errorIf(fmt.Errorf("role %q does not trust %q/%q", role.Name, claims.Issuer, claims.Subject), "")
+		writeSTSErrorResponse(w, ErrSTSAccessDenied)
+		return
+	}
+
+	policy := r.PostForm.Get("Policy")
+	if len(policy) > stsMaxPolicySize {
+		writeSTSErrorResponse(w, ErrSTSPackedPolicyTooLarge)
+		return
+	}
+
+	expiryTime, err := stsDurationFromForm(r, stsDefaultDurationSecs, stsMinDurationSecs, int64(role.maxSessionDuration()/time.Second))
+	if err != nil {
+		errorIf(err, "Unable to parse DurationSeconds")
 		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
 		return
 	}
 
-	// Keep TLS config.
-	tlsConfig := &tls.Config{
-		RootCAs:            globalRootCAs,
-		InsecureSkipVerify: true,
+	cred, err := getNewCredentialWithExpiry(expiryTime)
+	if err != nil {
+		errorIf(err, "Failed to generate new credentials with expiry.")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
 	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			TLSClientConfig:       tlsConfig,
+	sessionName := r.PostForm.Get("RoleSessionName")
+
+	// A federated WebIdentity subject is not a real MinIO IAM user, so
+	// ParentUser carries the assumed role's ARN and RolePolicy carries its
+	// attached policy; stsSessionIsAllowed evaluates that policy directly
+	// rather than looking ParentUser up as an IAM account.
+	registerSessionPolicy(cred, role.arn(), sessionName, claims.Subject, policy, role.Policy, expiryTime)
+
+	providerID := r.PostForm.Get("ProviderId")
+	if providerID == "" {
+		providerID = claims.Issuer
+	}
+
+	webIdentityOutput := &AssumeRoleWithWebIdentityResult{
+		AssumedRoleUser: AssumedRoleUser{
+			Arn:           role.assumedRoleArn(sessionName),
+			AssumedRoleID: role.assumedRoleID(sessionName),
 		},
+		Audience:                    claims.Audience,
+		Credentials:                 cred,
+		Provider:                    providerID,
+		SubjectFromWebIdentityToken: claims.Subject,
+		PackedPolicySize:            packedPolicySize(policy),
+	}
+
+	encodedSuccessResponse := encodeResponse(webIdentityOutput)
+	writeSuccessResponseXML(w, encodedSuccessResponse)
+}
+
+func (sts *stsAPIHandlers) AssumeRoleWithSAMLHandler(w http.ResponseWriter, r *http.Request) {
+	// This is an unauthenticated request.
+	if err := r.ParseForm(); err != nil {
+		errorIf(err, "Unable to parse incoming data.")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
+	}
+
+	if r.PostForm.Get("Version") != stsAPIVersion {
+		errorIf(errors.New("API version mismatch"), "")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
 	}
 
-	resp, rerr := client.PostForm(samlResp.Destination, url.Values{
-		"SAMLResponse": {samlResp.origSAMLAssertion},
-	})
-	if rerr != nil {
-		errorIf(rerr, "Unable to validate saml assertion.")
+	samlResp, err := ParseSAMLResponse(r.PostForm.Get("SAMLAssertion"))
+	if err != nil {
+		errorIf(err, "Unable to parse saml assertion.")
 		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
 		return
 	}
 
-	if resp.StatusCode >= http.StatusInternalServerError {
-		errorIf(errors.New(resp.Status), "Unable to validate saml assertion.")
+	if err = validateSAMLAssertion(samlResp, stsSAMLAssertionConsumerURL(r)); err != nil {
+		errorIf(err, "Unable to validate saml assertion.")
 		writeSTSErrorResponse(w, ErrSTSIDPRejectedClaim)
 		return
 	}
 
-	expiryTime := UTCNow().Add(time.Duration(240) * time.Minute) // Defaults to 4hrs.
-	if r.PostForm.Get("DurationSeconds") != "" {
-		expirySecs, serr := strconv.ParseInt(r.PostForm.Get("DurationSeconds"), 10, 64)
-		if serr != nil {
-			errorIf(serr, "Unable to parse DurationSeconds")
-			writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
-			return
-		}
+	nameID := samlResp.Assertion.Subject.NameID.Value
 
-		// The duration, in seconds, of the role session.
-		// The value can range from 900 seconds (15 minutes)
-		// to 14400 seconds (4 hours). By default, the value
-		// is set to 14400 seconds.
-		if expirySecs < 900 {
-			expirySecs = 900
-		}
+	role, ok := globalSTSRoles.Lookup(r.PostForm.Get("RoleArn"))
+	if !ok {
+		errorIf(fmt.Errorf("no such role %q", r.PostForm.Get("RoleArn")), "")
+		writeSTSErrorResponse(w, ErrSTSInvalidParameterValue)
+		return
+	}
 
-		if expirySecs > 14400 {
-			expirySecs = 14400
-		}
+	if !role.Trust.allowsSAML(samlResp.Issuer.URL, nameID) {
+		errorIf(fmt.Errorf("role %q does not trust %q/%q", role.Name, samlResp.Issuer.URL, nameID), "")
+		writeSTSErrorResponse(w, ErrSTSIDPRejectedClaim)
+		return
+	}
+
+	policy := r.PostForm.Get("Policy")
+	if len(policy) > stsMaxPolicySize {
+		writeSTSErrorResponse(w, ErrSTSPackedPolicyTooLarge)
+		return
+	}
 
-		expiryTime = UTCNow().Add(time.Duration(expirySecs) * time.Second)
+	expiryTime, err := stsSAMLSessionExpiry(r, role, samlResp)
+	if err == errSTSDurationExceedsRoleMax {
+		errorIf(err, "Requested DurationSeconds exceeds role MaxSessionDuration")
+		writeSTSErrorResponse(w, ErrSTSInvalidParameterValue)
+		return
+	}
+	if err != nil {
+		errorIf(err, "Unable to parse DurationSeconds")
+		writeSTSErrorResponse(w, ErrSTSMalformedPolicyDocument)
+		return
 	}
 
 	cred, err := getNewCredentialWithExpiry(expiryTime)
@@ -217,17 +622,27 @@ func (sts *stsAPIHandlers) AssumeRoleWithSAMLHandler(w http.ResponseWriter, r *h
 	io.WriteString(h, samlResp.Issuer.URL+"0000"+"myidp")
 	nq := base64.StdEncoding.EncodeToString(h.Sum(nil))
 
-	// Set the newly generated credentials.
-	globalServerCreds.SetCredential(cred)
+	sessionName := r.PostForm.Get("RoleSessionName")
+
+	// A federated SAML NameID is not a real MinIO IAM user, so ParentUser
+	// carries the assumed role's ARN and RolePolicy carries its attached
+	// policy; stsSessionIsAllowed evaluates that policy directly rather
+	// than looking ParentUser up as an IAM account.
+	registerSessionPolicy(cred, role.arn(), sessionName, nameID, policy, role.Policy, expiryTime)
 
 	samlOutput := &AssumeRoleWithSAMLResult{
-		Credentials: cred,
-		// TODO
-		// Subject:       samlResp.Assertion.Subject.NameID.Value,
-		// SubjectType:   samlResp.Assertion.Subject.NameID.Format,
+		AssumedRoleUser: AssumedRoleUser{
+			Arn:           role.assumedRoleArn(sessionName),
+			AssumedRoleID: role.assumedRoleID(sessionName),
+		},
+		Audience:      samlResp.Assertion.Subject.SubjectConfirmation.SubjectConfirmationData.Recipient,
+		Credentials:   cred,
 		Issuer:        samlResp.Issuer.URL,
 		NameQualifier: nq,
+		Subject:       nameID,
+		SubjectType:   stripNameIDFormatPrefix(samlResp.Assertion.Subject.NameID.Format),
 	}
+	samlOutput.PackedPolicySize = packedPolicySize(policy)
 
 	encodedSuccessResponse := encodeResponse(samlOutput)
 	writeSuccessResponseXML(w, encodedSuccessResponse)
@@ -0,0 +1,255 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// openIDProviderConfig carries the trust material needed to validate
+// WebIdentityToken JWTs issued by an external OpenID Connect provider
+// (Kubernetes service account tokens, Google, Auth0, etc).
+type openIDProviderConfig struct {
+	// Enabled toggles whether AssumeRoleWithWebIdentity is accepted at all.
+	Enabled bool `json:"enabled"`
+
+	// JWKSURL is fetched to obtain the provider's signing keys; the keys are
+	// cached and refetched only when a token carries an unknown kid or the
+	// URL changes.
+	JWKSURL string `json:"jwksURL"`
+
+	// Issuer is matched against the JWT "iss" claim.
+	Issuer string `json:"issuer"`
+
+	// ClientID, when non-empty, is matched against the JWT "aud" claim.
+	ClientID string `json:"clientID"`
+}
+
+// globalOpenIDConfig holds the currently configured OIDC provider. It is
+// populated from the "identity_openid" config subsection at startup, in the
+// same fashion globalServerConfig seeds other subsystems.
+var globalOpenIDConfig openIDProviderConfig
+
+// openIDConfigPath is where the "identity_openid" config subsection is
+// persisted in the config/etcd layer.
+const openIDConfigPath = "config/identity-openid.json"
+
+// loadOpenIDConfig reads the "identity_openid" config subsection from the
+// config/etcd layer and seeds globalOpenIDConfig from it, so that
+// validateWebIdentityJWT has trust material to validate against. Absent
+// config leaves globalOpenIDConfig at its zero value, i.e. disabled.
+func loadOpenIDConfig(objAPI ObjectLayer) error {
+	data, err := readConfig(objAPI, openIDConfigPath)
+	if err != nil {
+		if err == errConfigNotFound {
+			return nil
+		}
+		return err
+	}
+
+	var cfg openIDProviderConfig
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+
+	globalOpenIDConfig = cfg
+	return nil
+}
+
+// globalJWKS caches keys fetched from globalOpenIDConfig.JWKSURL so that
+// every incoming AssumeRoleWithWebIdentity request doesn't refetch them.
+var globalJWKS = &jwksCache{}
+
+type jwksCache struct {
+	mu       sync.RWMutex
+	keys     map[string]*rsa.PublicKey
+	fetchURL string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwksResponse struct {
+	Keys []jwk `json:"keys"`
+}
+
+// lookup returns the RSA public key for kid, fetching (and caching) the JWKS
+// document from jwksURL if it isn't already known.
+func (c *jwksCache) lookup(jwksURL, kid string) (*rsa.PublicKey, error) {
+	c.mu.RLock()
+	if c.fetchURL == jwksURL {
+		if key, ok := c.keys[kid]; ok {
+			c.mu.RUnlock()
+			return key, nil
+		}
+	}
+	c.mu.RUnlock()
+
+	if err := c.refresh(jwksURL); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("jwks: no key found for kid %q", kid)
+	}
+	return key, nil
+}
+
+func (c *jwksCache) refresh(jwksURL string) error {
+	resp, err := http.Get(jwksURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: unexpected status fetching %s: %s", jwksURL, resp.Status)
+	}
+
+	var doc jwksResponse
+	if err = json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := jwkToRSAPublicKey(k)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	c.mu.Lock()
+	c.fetchURL = jwksURL
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+func jwkToRSAPublicKey(k jwk) (*rsa.PublicKey, error) {
+	nb, err := base64URLDecode(k.N)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64URLDecode(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	e := 0
+	for _, b := range eb {
+		e = e<<8 | int(b)
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nb),
+		E: e,
+	}, nil
+}
+
+// webIdentityClaims is the subset of the JWT claims we care about for
+// federating a WebIdentityToken into a MinIO session.
+type webIdentityClaims struct {
+	Issuer   string `json:"iss"`
+	Subject  string `json:"sub"`
+	Audience string `json:"aud"`
+}
+
+// validateWebIdentityJWT verifies the signature, issuer, audience and
+// expiry of token against the configured OIDC provider and returns the
+// claims on success.
+func validateWebIdentityJWT(token string) (*webIdentityClaims, error) {
+	if !globalOpenIDConfig.Enabled {
+		return nil, errors.New("sts: WebIdentity federation is not configured")
+	}
+
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		// Assert the signing method before handing back the provider's RSA
+		// public key: without this check, a forged token with alg:HS256
+		// would have its signature "verified" by HMAC-ing with the public
+		// key bytes as the secret, since jwt-go trusts the token header to
+		// pick the verification algorithm.
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("sts: unexpected signing method %q", t.Header["alg"])
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return globalJWKS.lookup(globalOpenIDConfig.JWKSURL, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return nil, errors.New("sts: invalid WebIdentityToken")
+	}
+
+	if err = claims.Valid(); err != nil {
+		return nil, err
+	}
+
+	iss, _ := claims["iss"].(string)
+	if iss != globalOpenIDConfig.Issuer {
+		return nil, fmt.Errorf("sts: unexpected issuer %q", iss)
+	}
+
+	if globalOpenIDConfig.ClientID != "" && !claims.VerifyAudience(globalOpenIDConfig.ClientID, true) {
+		return nil, errors.New("sts: token audience does not match configured client ID")
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("sts: WebIdentityToken is missing a \"sub\" claim")
+	}
+
+	var aud string
+	switch v := claims["aud"].(type) {
+	case string:
+		aud = v
+	case []interface{}:
+		if len(v) > 0 {
+			aud, _ = v[0].(string)
+		}
+	}
+
+	return &webIdentityClaims{Issuer: iss, Subject: sub, Audience: aud}, nil
+}
+
+func base64URLDecode(s string) ([]byte, error) {
+	return jwt.DecodeSegment(s)
+}
@@ -0,0 +1,77 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestValidateWebIdentityJWTRejectsAlgConfusion guards against the classic
+// jwt-go algorithm-confusion vulnerability: a token claiming alg:HS256,
+// "verified" by HMAC-ing with the provider's RSA public key bytes as the
+// secret. Before validateWebIdentityJWT's keyfunc asserted the signing
+// method, it handed back that same *rsa.PublicKey regardless of alg, and
+// jwt-go's HS256 verifier happily treated it as a shared secret.
+func TestValidateWebIdentityJWTRejectsAlgConfusion(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pub := &priv.PublicKey
+
+	const kid = "test-kid"
+
+	globalOpenIDConfig = openIDProviderConfig{
+		Enabled: true,
+		JWKSURL: "https://idp.example.com/jwks",
+		Issuer:  "https://idp.example.com",
+	}
+	defer func() { globalOpenIDConfig = openIDProviderConfig{} }()
+
+	globalJWKS.mu.Lock()
+	globalJWKS.fetchURL = globalOpenIDConfig.JWKSURL
+	globalJWKS.keys = map[string]*rsa.PublicKey{kid: pub}
+	globalJWKS.mu.Unlock()
+	defer func() {
+		globalJWKS.mu.Lock()
+		globalJWKS.fetchURL = ""
+		globalJWKS.keys = nil
+		globalJWKS.mu.Unlock()
+	}()
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": globalOpenIDConfig.Issuer,
+		"sub": "attacker",
+		"aud": "test-client",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	forged.Header["kid"] = kid
+
+	tokenString, err := forged.SignedString(pub.N.Bytes())
+	if err != nil {
+		t.Fatalf("sign forged token: %v", err)
+	}
+
+	if _, err = validateWebIdentityJWT(tokenString); err == nil {
+		t.Fatal("forged HS256 token using the RSA public key as an HMAC secret was accepted, want rejection")
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+)
+
+// stsRoleConfigPrefix is the config-tree prefix under which admin-defined
+// STS role definitions are persisted, mirroring how stsSessionConfigPrefix
+// lays out issued sessions under config/iam/sts/.
+const stsRoleConfigPrefix = "config/iam/sts-roles/"
+
+// globalMinioDefaultAccountID stands in for the AWS account ID segment of
+// an ARN; MinIO has no notion of an AWS account, so every deployment uses
+// the same fixed value.
+const globalMinioDefaultAccountID = "minio"
+
+// stsTrustPolicy restricts which federated principals may assume a role.
+// A role is assumable if it matches at least one configured issuer, and
+// either no subjects are listed (any subject from a trusted issuer is
+// allowed) or the assertion's subject appears in the list.
+type stsTrustPolicy struct {
+	SAMLIssuers  []string `json:"samlIssuers,omitempty"`
+	SAMLSubjects []string `json:"samlSubjects,omitempty"`
+	OIDCIssuers  []string `json:"oidcIssuers,omitempty"`
+	OIDCSubjects []string `json:"oidcSubjects,omitempty"`
+}
+
+func matchesSubjectList(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsSAML reports whether a SAML assertion from issuer carrying NameID
+// subject satisfies this trust policy.
+func (t stsTrustPolicy) allowsSAML(issuer, subject string) bool {
+	if !containsString(t.SAMLIssuers, issuer) {
+		return false
+	}
+	return matchesSubjectList(t.SAMLSubjects, subject)
+}
+
+// allowsOIDC reports whether a WebIdentityToken from issuer carrying "sub"
+// subject satisfies this trust policy.
+func (t stsTrustPolicy) allowsOIDC(issuer, subject string) bool {
+	if !containsString(t.OIDCIssuers, issuer) {
+		return false
+	}
+	return matchesSubjectList(t.OIDCSubjects, subject)
+}
+
+// stsRole is an admin-defined named role that SAML/OIDC principals can
+// assume, analogous to an AWS IAM role.
+//
+// stsRole has custom MarshalJSON/UnmarshalJSON methods, so none of its
+// fields carry json tags of their own; see stsRoleJSON.
+type stsRole struct {
+	// Name is the role's friendly name, the last component of its ARN.
+	Name string
+
+	// ID is this role's immutable identifier, used to build
+	// AssumedRoleUser.AssumedRoleId as "<roleID>:<sessionName>".
+	ID string
+
+	// Policy is the name of the IAM policy attached to this role, applied
+	// to every session assuming it.
+	Policy string
+
+	// Trust lists which SAML/OIDC principals may assume this role.
+	Trust stsTrustPolicy
+
+	// MaxSessionDuration bounds how long DurationSeconds may request a
+	// session for when assuming this role, mirroring IAM's role setting
+	// of the same name. Valid range is 1-12 hours; zero means "unset",
+	// in which case maxSessionDuration falls back to the AWS default of
+	// one hour.
+	MaxSessionDuration time.Duration
+}
+
+// stsRoleJSON is the wire format for stsRole: MaxSessionDuration is carried
+// in whole seconds rather than time.Duration's default nanoseconds, so that
+// an admin PUTing e.g. "maxSessionDuration": 43200 gets the 12 hours they
+// mean instead of 43.2 microseconds.
+type stsRoleJSON struct {
+	Name               string         `json:"name"`
+	ID                 string         `json:"id"`
+	Policy             string         `json:"policy"`
+	Trust              stsTrustPolicy `json:"trust"`
+	MaxSessionDuration int64          `json:"maxSessionDuration"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding MaxSessionDuration in
+// seconds.
+func (role *stsRole) MarshalJSON() ([]byte, error) {
+	return json.Marshal(stsRoleJSON{
+		Name:               role.Name,
+		ID:                 role.ID,
+		Policy:             role.Policy,
+		Trust:              role.Trust,
+		MaxSessionDuration: int64(role.MaxSessionDuration / time.Second),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding MaxSessionDuration
+// from seconds.
+func (role *stsRole) UnmarshalJSON(data []byte) error {
+	var aux stsRoleJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	role.Name = aux.Name
+	role.ID = aux.ID
+	role.Policy = aux.Policy
+	role.Trust = aux.Trust
+	role.MaxSessionDuration = time.Duration(aux.MaxSessionDuration) * time.Second
+	return nil
+}
+
+// arn returns this role's IAM ARN, e.g. arn:aws:iam::minio:role/my-role.
+func (role *stsRole) arn() string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", globalMinioDefaultAccountID, role.Name)
+}
+
+// maxSessionDuration returns this role's configured MaxSessionDuration,
+// falling back to the AWS default of one hour when unset.
+func (role *stsRole) maxSessionDuration() time.Duration {
+	if role.MaxSessionDuration == 0 {
+		return time.Hour
+	}
+	return role.MaxSessionDuration
+}
+
+// assumedRoleArn returns the ARN of the temporary credentials minted for
+// sessionName assuming this role, e.g.
+// arn:aws:sts::minio:assumed-role/my-role/session.
+func (role *stsRole) assumedRoleArn(sessionName string) string {
+	return fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%s", globalMinioDefaultAccountID, role.Name, sessionName)
+}
+
+// assumedRoleID returns the "<roleID>:<sessionName>" identifier reported as
+// AssumedRoleUser.AssumedRoleId.
+func (role *stsRole) assumedRoleID(sessionName string) string {
+	return role.ID + ":" + sessionName
+}
+
+// stsRoleStore is the admin-managed table of roles SAML/OIDC principals can
+// assume, keyed by ARN.
+type stsRoleStore struct {
+	mu    sync.RWMutex
+	roles map[string]*stsRole
+}
+
+var globalSTSRoles = &stsRoleStore{roles: make(map[string]*stsRole)}
+
+// Register adds or replaces a role definition and persists it to the
+// config/etcd layer so it survives a restart and is visible to every node
+// in the cluster, mirroring stsCredentialsStore.Put.
+func (s *stsRoleStore) Register(objAPI ObjectLayer, role *stsRole) error {
+	s.mu.Lock()
+	s.roles[role.arn()] = role
+	s.mu.Unlock()
+
+	return s.persist(objAPI, role)
+}
+
+// Lookup returns the role with the given ARN, if any.
+func (s *stsRoleStore) Lookup(roleArn string) (*stsRole, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.roles[roleArn]
+	return role, ok
+}
+
+// List returns every currently registered role, for admin inspection.
+func (s *stsRoleStore) List() []*stsRole {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]*stsRole, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// Delete removes a role definition by name, so it can no longer be assumed.
+// Sessions already issued against it are unaffected; they expire naturally
+// or are revoked separately via globalSTSCredentials.Revoke.
+func (s *stsRoleStore) Delete(objAPI ObjectLayer, name string) error {
+	arn := (&stsRole{Name: name}).arn()
+
+	s.mu.Lock()
+	delete(s.roles, arn)
+	s.mu.Unlock()
+
+	if objAPI != nil {
+		if err := deleteConfig(objAPI, s.configPath(name)); err != nil && err != errConfigNotFound {
+			return err
+		}
+	}
+
+	if globalEtcdClient != nil {
+		return deleteConfigEtcd(globalEtcdClient, s.configPath(name))
+	}
+
+	return nil
+}
+
+func (s *stsRoleStore) configPath(name string) string {
+	return path.Join(stsRoleConfigPrefix, name+".json")
+}
+
+func (s *stsRoleStore) persist(objAPI ObjectLayer, role *stsRole) error {
+	data, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+
+	if objAPI != nil {
+		if err = saveConfig(objAPI, s.configPath(role.Name), data); err != nil {
+			return err
+		}
+	}
+
+	if globalEtcdClient != nil {
+		return saveConfigEtcd(globalEtcdClient, s.configPath(role.Name), data)
+	}
+
+	return nil
+}
+
+// loadSTSRoles reads back every persisted role definition under
+// config/iam/sts-roles/ on startup, so that role definitions created via
+// the admin API survive a restart and are honored by every member of a
+// distributed cluster.
+func loadSTSRoles(objAPI ObjectLayer) error {
+	entries, err := listConfig(objAPI, stsRoleConfigPrefix)
+	if err != nil {
+		if err == errConfigNotFound {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		data, rerr := readConfig(objAPI, entry)
+		if rerr != nil {
+			continue
+		}
+
+		var role stsRole
+		if jerr := json.Unmarshal(data, &role); jerr != nil {
+			continue
+		}
+
+		globalSTSRoles.mu.Lock()
+		globalSTSRoles.roles[role.arn()] = &role
+		globalSTSRoles.mu.Unlock()
+	}
+
+	return nil
+}
+
+// stripNameIDFormatPrefix removes the urn:oasis:names:tc:SAML:2.0:nameid-format:
+// prefix from a SAML NameID Format, as AWS does when it reports SubjectType,
+// e.g. "...nameid-format:transient" becomes "transient".
+func stripNameIDFormatPrefix(format string) string {
+	const prefix = "urn:oasis:names:tc:SAML:2.0:nameid-format:"
+	if len(format) > len(prefix) && format[:len(prefix)] == prefix {
+		return format[len(prefix):]
+	}
+	return format
+}
@@ -0,0 +1,88 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTrustPolicyDeniesUntrustedPrincipal guards the other half of the
+// AssumeRoleWithSAML/WithWebIdentity trust boundary: even once a SAML
+// assertion or OIDC token is cryptographically verified, the issuing
+// IdP/subject must still appear in the role's trust policy before the role
+// can be assumed.
+func TestTrustPolicyDeniesUntrustedPrincipal(t *testing.T) {
+	trust := stsTrustPolicy{
+		OIDCIssuers:  []string{"https://idp.example.com"},
+		OIDCSubjects: []string{"allowed-subject"},
+	}
+	if trust.allowsOIDC("https://untrusted.example.com", "allowed-subject") {
+		t.Error("allowsOIDC: expected an untrusted issuer to be denied")
+	}
+	if trust.allowsOIDC("https://idp.example.com", "someone-else") {
+		t.Error("allowsOIDC: expected an untrusted subject to be denied")
+	}
+	if !trust.allowsOIDC("https://idp.example.com", "allowed-subject") {
+		t.Error("allowsOIDC: expected the trusted issuer/subject pair to be allowed")
+	}
+
+	samlTrust := stsTrustPolicy{SAMLIssuers: []string{"https://idp.example.com"}}
+	if samlTrust.allowsSAML("https://untrusted.example.com", "anyone") {
+		t.Error("allowsSAML: expected an untrusted issuer to be denied")
+	}
+	if !samlTrust.allowsSAML("https://idp.example.com", "anyone") {
+		t.Error("allowsSAML: expected a trusted issuer with no subject restriction to be allowed")
+	}
+}
+
+// TestSTSRoleMaxSessionDurationJSONRoundTripsAsSeconds guards against
+// time.Duration's default nanosecond JSON encoding: an admin PUTing
+// "maxSessionDuration": 43200 means 12 hours, not 43.2 microseconds.
+func TestSTSRoleMaxSessionDurationJSONRoundTripsAsSeconds(t *testing.T) {
+	role := &stsRole{Name: "test-role", MaxSessionDuration: 12 * time.Hour}
+
+	data, err := json.Marshal(role)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"maxSessionDuration":43200`) {
+		t.Fatalf("expected maxSessionDuration to be marshaled as 43200 seconds, got %s", data)
+	}
+
+	var round stsRole
+	if err = json.Unmarshal(data, &round); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if round.MaxSessionDuration != 12*time.Hour {
+		t.Errorf("round-tripped MaxSessionDuration = %v, want %v", round.MaxSessionDuration, 12*time.Hour)
+	}
+}
+
+func TestSTSRoleMaxSessionDurationDefaultsToOneHour(t *testing.T) {
+	role := &stsRole{Name: "test-role"}
+	if got := role.maxSessionDuration(); got != time.Hour {
+		t.Errorf("maxSessionDuration() with unset MaxSessionDuration = %v, want %v", got, time.Hour)
+	}
+
+	role.MaxSessionDuration = 12 * time.Hour
+	if got := role.maxSessionDuration(); got != 12*time.Hour {
+		t.Errorf("maxSessionDuration() = %v, want %v", got, 12*time.Hour)
+	}
+}
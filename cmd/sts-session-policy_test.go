@@ -0,0 +1,93 @@
+/*
+ * Minio Cloud Storage, (C) 2018 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	iampolicy "github.com/minio/minio/pkg/iam/policy"
+)
+
+// TestRequestActionMapsSubResourcesDistinctly guards against collapsing
+// every non-GET/DELETE method to PutObjectAction and every DELETE to
+// DeleteObjectAction regardless of sub-resource, either of which would
+// over- or under-authorize a session relative to the request it's actually
+// making.
+func TestRequestActionMapsSubResourcesDistinctly(t *testing.T) {
+	cases := []struct {
+		method string
+		path   string
+		query  string
+		object string
+		want   iampolicy.Action
+	}{
+		{http.MethodDelete, "/bucket", "", "", iampolicy.DeleteBucketAction},
+		{http.MethodDelete, "/bucket/key", "", "key", iampolicy.DeleteObjectAction},
+		{http.MethodDelete, "/bucket/key", "tagging=", "key", iampolicy.DeleteObjectTaggingAction},
+		{http.MethodPut, "/bucket/key", "acl=", "key", iampolicy.PutObjectAclAction},
+		{http.MethodPut, "/bucket/key", "tagging=", "key", iampolicy.PutObjectTaggingAction},
+		{http.MethodPut, "/bucket/key", "", "key", iampolicy.PutObjectAction},
+		{http.MethodPut, "/bucket", "", "", iampolicy.CreateBucketAction},
+		{http.MethodGet, "/bucket/key", "tagging=", "key", iampolicy.GetObjectTaggingAction},
+		{http.MethodGet, "/bucket", "location=", "", iampolicy.GetBucketLocationAction},
+		{http.MethodGet, "/bucket", "", "", iampolicy.ListBucketAction},
+		{http.MethodPost, "/bucket/key", "uploads=", "key", iampolicy.PutObjectAction},
+	}
+	for _, tc := range cases {
+		u := "http://localhost" + tc.path
+		if tc.query != "" {
+			u += "?" + tc.query
+		}
+		r, err := http.NewRequest(tc.method, u, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		if got := requestAction(r, tc.object); got != tc.want {
+			t.Errorf("%s %s: requestAction = %v, want %v", tc.method, u, got, tc.want)
+		}
+	}
+}
+
+// TestRegisterSessionPolicyScopesFederatedSessionToRole guards against a
+// federated (SAML/OIDC) session being registered with the raw federated
+// subject as ParentUser: there is no IAM user behind that subject for
+// globalIAMSys.IsAllowed to find, so such a session must instead carry the
+// assumed role's ARN as ParentUser and its attached policy as RolePolicy.
+func TestRegisterSessionPolicyScopesFederatedSessionToRole(t *testing.T) {
+	role := &stsRole{Name: "test-federated-role", ID: "roleid", Policy: "readonly"}
+	cred := credential{AccessKey: "test-federated-session-ak"}
+	expiry := UTCNow().Add(time.Hour)
+
+	registerSessionPolicy(cred, role.arn(), "session1", "federated-subject", "", role.Policy, expiry)
+	defer globalSTSCredentials.Revoke(nil, cred.AccessKey)
+
+	sess, ok := globalSTSCredentials.Get(cred.AccessKey)
+	if !ok {
+		t.Fatalf("expected session to be registered for %s", cred.AccessKey)
+	}
+	if sess.ParentUser != role.arn() {
+		t.Errorf("ParentUser = %q, want role ARN %q", sess.ParentUser, role.arn())
+	}
+	if sess.RolePolicy != role.Policy {
+		t.Errorf("RolePolicy = %q, want %q", sess.RolePolicy, role.Policy)
+	}
+	if sess.Subject != "federated-subject" {
+		t.Errorf("Subject = %q, want %q", sess.Subject, "federated-subject")
+	}
+}